@@ -0,0 +1,157 @@
+package k8swatch
+
+import (
+	"container/heap"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tilt-dev/tilt/internal/store/k8sconv"
+)
+
+// podRVWindow is how long podEventQueue waits, per pod UID, for a
+// higher-resourceVersion event to arrive before dispatching what it's got.
+// It exists to absorb the apiserver occasionally delivering two updates for
+// the same pod out of order, and to coalesce bursts of rapid-fire updates
+// (e.g. a container restarting several times in a row) into a single
+// dispatch.
+const podRVWindow = 10 * time.Millisecond
+
+// podResourceVersion parses a pod's resourceVersion as a number so events
+// can be ordered numerically instead of with a string comparison: Tilt used
+// to compare resourceVersions as strings, which meant an update for RV "10"
+// sorted *before* one for RV "9". A missing or non-numeric resourceVersion
+// parses as 0, which is never treated as newer than anything.
+func podResourceVersion(pod *corev1.Pod) int64 {
+	rv, _ := strconv.ParseInt(pod.ResourceVersion, 10, 64)
+	return rv
+}
+
+// podRVItem is a single event buffered in a pod's priority queue while it
+// waits out the debounce window.
+type podRVItem struct {
+	pod *corev1.Pod
+	rv  int64
+}
+
+// podRVHeap is a max-heap of podRVItems, so the highest resourceVersion
+// queued for a pod is always at the root.
+type podRVHeap []*podRVItem
+
+func (h podRVHeap) Len() int            { return len(h) }
+func (h podRVHeap) Less(i, j int) bool  { return h[i].rv > h[j].rv }
+func (h podRVHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *podRVHeap) Push(x interface{}) { *h = append(*h, x.(*podRVItem)) }
+func (h *podRVHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// podEventQueue reorders and de-bounces the raw pod events coming off a
+// watch stream before they reach PodWatcher's matching/dispatch logic.
+//
+// Each pod UID gets its own priority queue, keyed by numeric resourceVersion
+// (not a string compare -- RV "10" must sort after RV "9"). The first event
+// for a UID starts a podRVWindow timer; every event for that UID that
+// arrives before the timer fires is pushed onto the same heap rather than
+// dispatched immediately, so a brief burst of updates (or one arriving
+// slightly out of order) gets coalesced into a single dispatch of the
+// highest RV seen. Once the window closes, anything left in the heap that's
+// not the max is simply superseded and dropped -- only the newest state of
+// the pod matters to callers.
+//
+// An event carrying a DisruptionTarget condition is exempt from coalescing:
+// Kubernetes can drop that condition again on the very next update (e.g.
+// right before the pod is actually deleted), so an event that carries it may
+// be the only chance to ever see it. Such an event is dispatched immediately
+// rather than risking it getting superseded in the window by a later,
+// condition-free update for the same UID.
+//
+// Updates whose RV doesn't move the UID forward at all -- i.e. is stale
+// relative to the last dispatched RV -- are dropped on arrival.
+type podEventQueue struct {
+	mu       sync.Mutex
+	window   time.Duration
+	dispatch func(pod *corev1.Pod)
+
+	lastDispatchedRV map[types.UID]int64
+	pending          map[types.UID]*podRVHeap
+}
+
+func newPodEventQueue(window time.Duration, dispatch func(pod *corev1.Pod)) *podEventQueue {
+	return &podEventQueue{
+		window:           window,
+		dispatch:         dispatch,
+		lastDispatchedRV: make(map[types.UID]int64),
+		pending:          make(map[types.UID]*podRVHeap),
+	}
+}
+
+// add enqueues an incoming pod event.
+func (q *podEventQueue) add(pod *corev1.Pod) {
+	uid := pod.UID
+	rv := podResourceVersion(pod)
+
+	q.mu.Lock()
+
+	if rv != 0 && rv < q.lastDispatchedRV[uid] {
+		// Stale: we've already dispatched something newer for this pod.
+		q.mu.Unlock()
+		return
+	}
+
+	if k8sconv.HasDisruptionCondition(pod) {
+		if rv != 0 {
+			q.lastDispatchedRV[uid] = rv
+		}
+		// Drop any event already buffered for this UID -- it's older than
+		// what we're dispatching now, and its timer firing into an empty
+		// q.pending[uid] is a no-op in flush, so it never gets dispatched
+		// out of order behind us.
+		delete(q.pending, uid)
+		q.mu.Unlock()
+		q.dispatch(pod)
+		return
+	}
+
+	h := q.pending[uid]
+	if h == nil {
+		h = &podRVHeap{}
+		q.pending[uid] = h
+		time.AfterFunc(q.window, func() { q.flush(uid) })
+	}
+	heap.Push(h, &podRVItem{pod: pod, rv: rv})
+	q.mu.Unlock()
+}
+
+// flush dispatches the highest-RV event queued for uid, discarding any
+// lower-RV events that arrived alongside it during the window.
+func (q *podEventQueue) flush(uid types.UID) {
+	q.mu.Lock()
+	h := q.pending[uid]
+	delete(q.pending, uid)
+	if h == nil || h.Len() == 0 {
+		q.mu.Unlock()
+		return
+	}
+	top := heap.Pop(h).(*podRVItem)
+	if top.rv != 0 && top.rv <= q.lastDispatchedRV[uid] {
+		// Superseded while this window was open, e.g. by a DisruptionTarget
+		// event that bypassed the queue entirely -- don't regress
+		// lastDispatchedRV or dispatch something stale.
+		q.mu.Unlock()
+		return
+	}
+	if top.rv != 0 {
+		q.lastDispatchedRV[uid] = top.rv
+	}
+	q.mu.Unlock()
+
+	q.dispatch(top.pod)
+}
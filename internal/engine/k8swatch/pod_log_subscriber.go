@@ -0,0 +1,295 @@
+package k8swatch
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tilt-dev/tilt/internal/k8s"
+	"github.com/tilt-dev/tilt/internal/store"
+	"github.com/tilt-dev/tilt/pkg/apis/core/v1alpha1"
+	"github.com/tilt-dev/tilt/pkg/model"
+)
+
+// PodLogAction carries a chunk of log output observed from a single
+// container in a single pod.
+type PodLogAction struct {
+	ManifestName  model.ManifestName
+	PodID         k8s.PodID
+	ContainerName string
+	Content       []byte
+}
+
+func (PodLogAction) Action() {}
+
+// streamError classifies an error encountered while reading a container log
+// stream, so callers can tell a transient blip (reconnect) from a terminal
+// condition (give up).
+type streamError struct {
+	error
+	recoverable bool
+}
+
+func newStreamError(err error, recoverable bool) streamError {
+	return streamError{error: err, recoverable: recoverable}
+}
+
+func classifyStreamError(err error) streamError {
+	if err == nil || err == io.EOF {
+		return newStreamError(err, true)
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"),
+		strings.Contains(msg, "NotFound"),
+		strings.Contains(msg, "terminated"):
+		// The pod or container is gone for good -- retrying won't help.
+		return newStreamError(err, false)
+	case strings.Contains(msg, "connection reset"),
+		strings.Contains(msg, "EOF"),
+		strings.Contains(msg, "transport is closing"):
+		return newStreamError(err, true)
+	default:
+		// Default to recoverable: an apiserver blip shouldn't permanently
+		// kill a subscriber that might otherwise keep logging fine.
+		return newStreamError(err, true)
+	}
+}
+
+const (
+	logBackoffStart = 500 * time.Millisecond
+	logBackoffMax   = 15 * time.Second
+)
+
+// containerLogClient is the narrow slice of k8s.Client that podLogSubscriber
+// needs, so tests can fake it without standing up a full k8s.Client.
+type containerLogClient interface {
+	GetContainerLogs(ctx context.Context, podID k8s.PodID, cName string, n k8s.Namespace, startTime time.Time) (io.ReadCloser, error)
+}
+
+// dispatcher is the narrow slice of store.RStore that podLogSubscriber
+// needs, so tests can fake it without standing up a full store.
+type dispatcher interface {
+	Dispatch(action store.Action)
+}
+
+// podLogSubscriber streams logs for a single (manifest, pod, container)
+// tuple, reopening the stream on recoverable errors with exponential
+// backoff.
+type podLogSubscriber struct {
+	ctx    context.Context
+	cancel func()
+
+	kCli containerLogClient
+	st   dispatcher
+
+	manifestName model.ManifestName
+	podID        k8s.PodID
+	namespace    k8s.Namespace
+
+	mu            sync.Mutex
+	containerName string
+	startTime     time.Time
+}
+
+func newPodLogSubscriber(ctx context.Context, kCli containerLogClient, st dispatcher, manifestName model.ManifestName, podID k8s.PodID, namespace k8s.Namespace, containerName string) *podLogSubscriber {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &podLogSubscriber{
+		ctx:           ctx,
+		cancel:        cancel,
+		kCli:          kCli,
+		st:            st,
+		manifestName:  manifestName,
+		podID:         podID,
+		namespace:     namespace,
+		containerName: containerName,
+	}
+	go s.run()
+	return s
+}
+
+func (s *podLogSubscriber) currentContainer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.containerName
+}
+
+func (s *podLogSubscriber) teardown() {
+	s.cancel()
+}
+
+func (s *podLogSubscriber) run() {
+	log := logr.FromContextOrDiscard(s.ctx).WithValues(
+		"manifest", s.manifestName, "pod", s.podID, "namespace", s.namespace)
+
+	backoff := logBackoffStart
+	for {
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		cName := s.currentContainer()
+		containerLog := log.WithValues("container", cName)
+		readCloser, err := s.kCli.GetContainerLogs(s.ctx, s.podID, cName, s.namespace, s.startTime)
+		if err != nil {
+			if !classifyStreamError(err).recoverable {
+				containerLog.Error(err, "log stream ended, giving up")
+				return
+			}
+			containerLog.Error(err, "opening log stream, will retry")
+			if !s.sleepBackoff(&backoff) {
+				return
+			}
+			continue
+		}
+
+		lastRead := s.consume(readCloser)
+		_ = readCloser.Close()
+
+		if lastRead == nil {
+			// Clean EOF with no error -- the container is still around, so
+			// treat this like any other recoverable disconnect and resume
+			// from where we left off.
+			backoff = logBackoffStart
+			if !s.sleepBackoff(&backoff) {
+				return
+			}
+			continue
+		}
+
+		se := classifyStreamError(lastRead)
+		if !se.recoverable {
+			containerLog.Error(lastRead, "log stream ended, giving up")
+			return
+		}
+		containerLog.Error(lastRead, "log stream disconnected, reconnecting")
+		if !s.sleepBackoff(&backoff) {
+			return
+		}
+	}
+}
+
+// consume reads lines off the stream and dispatches them, resetting the
+// resume point as it goes so a reconnect doesn't re-emit lines we already
+// saw. It returns the error that ended the read, or nil on a clean close.
+func (s *podLogSubscriber) consume(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		s.mu.Lock()
+		s.startTime = time.Now()
+		cName := s.containerName
+		s.mu.Unlock()
+
+		line := append(scanner.Bytes(), '\n')
+		s.st.Dispatch(PodLogAction{
+			ManifestName:  s.manifestName,
+			PodID:         s.podID,
+			ContainerName: cName,
+			Content:       line,
+		})
+	}
+	return scanner.Err()
+}
+
+func (s *podLogSubscriber) sleepBackoff(backoff *time.Duration) bool {
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-time.After(*backoff):
+	}
+	*backoff *= 2
+	if *backoff > logBackoffMax {
+		*backoff = logBackoffMax
+	}
+	return true
+}
+
+// subscriberKey identifies a single podLogSubscriber by the
+// (manifest, pod, container) tuple it streams logs for.
+type subscriberKey struct {
+	manifestName  model.ManifestName
+	podUID        types.UID
+	containerName string
+}
+
+// PodLogManager opens a podLogSubscriber for every running container as soon
+// as PodWatcher reports it, and tears each one down once its container
+// stops being live (the container exits, or the pod goes away entirely). A
+// pod with more than one container running at once -- e.g. a sidecar
+// alongside the main container -- gets a subscriber per container, all
+// streaming concurrently.
+type PodLogManager struct {
+	mu          sync.Mutex
+	kCli        containerLogClient
+	subscribers map[subscriberKey]*podLogSubscriber
+}
+
+func NewPodLogManager(kCli k8s.Client) *PodLogManager {
+	return &PodLogManager{
+		kCli:        kCli,
+		subscribers: make(map[subscriberKey]*podLogSubscriber),
+	}
+}
+
+func (m *PodLogManager) OnChange(ctx context.Context, st store.RStore, summary store.ChangeSummary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := st.RLockState()
+	live := make(map[subscriberKey]bool)
+	for _, mt := range state.Targets() {
+		m2 := mt.Manifest
+		if !m2.IsK8s() {
+			continue
+		}
+		runtimeState := mt.State.K8sRuntimeState()
+		for _, pod := range runtimeState.Pods {
+			for _, cName := range runningContainerNames(pod) {
+				key := subscriberKey{manifestName: m2.Name, podUID: types.UID(pod.Name), containerName: cName}
+				live[key] = true
+
+				if _, ok := m.subscribers[key]; ok {
+					continue
+				}
+				m.subscribers[key] = newPodLogSubscriber(ctx, m.kCli, st, m2.Name, k8s.PodID(pod.Name), k8s.Namespace(pod.Namespace), cName)
+			}
+		}
+	}
+	st.RUnlockState()
+
+	for key, sub := range m.subscribers {
+		if !live[key] {
+			sub.teardown()
+			delete(m.subscribers, key)
+		}
+	}
+}
+
+// runningContainerNames returns the name of every currently-running
+// container in the pod -- main containers and init containers alike -- so
+// PodLogManager can open a subscriber for each one. More than one main
+// container can be running concurrently (e.g. a sidecar), and each needs
+// its own log stream.
+func runningContainerNames(pod v1alpha1.Pod) []string {
+	var names []string
+	for _, c := range pod.Containers {
+		if c.State == "running" {
+			names = append(names, c.Name)
+		}
+	}
+	for _, c := range pod.InitContainers {
+		if c.State == "running" {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,256 @@
+package k8swatch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tilt-dev/tilt/internal/k8s"
+	"github.com/tilt-dev/tilt/internal/k8s/testyaml"
+	"github.com/tilt-dev/tilt/internal/store"
+	"github.com/tilt-dev/tilt/internal/store/k8sconv"
+	"github.com/tilt-dev/tilt/internal/testutils"
+	"github.com/tilt-dev/tilt/internal/testutils/manifestbuilder"
+	"github.com/tilt-dev/tilt/internal/testutils/tempdir"
+	"github.com/tilt-dev/tilt/pkg/apis/core/v1alpha1"
+	"github.com/tilt-dev/tilt/pkg/model"
+)
+
+// fakeLogClient hands out a scripted sequence of readers -- some of which
+// error out mid-read -- to exercise podLogSubscriber's reconnect logic.
+type fakeLogClient struct {
+	mu      sync.Mutex
+	streams []io.ReadCloser
+	calls   int
+}
+
+func (c *fakeLogClient) GetContainerLogs(ctx context.Context, podID k8s.PodID, cName string, n k8s.Namespace, startTime time.Time) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls >= len(c.streams) {
+		return nil, errors.New("container not found")
+	}
+	s := c.streams[c.calls]
+	c.calls++
+	return s, nil
+}
+
+func (c *fakeLogClient) callCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// breakingReader yields `lines`, then fails with a recoverable connection
+// reset instead of returning a clean EOF.
+type breakingReader struct {
+	lines []string
+	i     int
+}
+
+func (r *breakingReader) Read(p []byte) (int, error) {
+	if r.i >= len(r.lines) {
+		return 0, errors.New("connection reset by peer")
+	}
+	line := r.lines[r.i] + "\n"
+	r.i++
+	n := copy(p, line)
+	return n, nil
+}
+
+func (r *breakingReader) Close() error { return nil }
+
+// fakeLogStore is a minimal dispatcher that records every PodLogAction it
+// receives, so the test can assert on the accumulated log content.
+type fakeLogStore struct {
+	mu   sync.Mutex
+	logs []PodLogAction
+}
+
+func (s *fakeLogStore) Dispatch(action store.Action) {
+	a, ok := action.(PodLogAction)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, a)
+}
+
+func (s *fakeLogStore) content() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sb strings.Builder
+	for _, l := range s.logs {
+		sb.Write(l.Content)
+	}
+	return sb.String()
+}
+
+func TestPodLogSubscriberReconnectsOnRecoverableError(t *testing.T) {
+	client := &fakeLogClient{
+		streams: []io.ReadCloser{
+			&breakingReader{lines: []string{"line1", "line2"}},
+			&breakingReader{lines: []string{"line3", "line4"}},
+		},
+	}
+	st := &fakeLogStore{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := newPodLogSubscriber(ctx, client, st, model.ManifestName("server"), k8s.PodID("pod1"), k8s.DefaultNamespace, "main")
+	defer sub.teardown()
+
+	require.Eventually(t, func() bool {
+		return st.content() == "line1\nline2\nline3\nline4\n"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPodLogSubscriberStopsOnTerminalError(t *testing.T) {
+	client := &fakeLogClient{
+		streams: []io.ReadCloser{
+			&breakingReader{lines: []string{"line1"}},
+		},
+	}
+	st := &fakeLogStore{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := newPodLogSubscriber(ctx, client, st, model.ManifestName("server"), k8s.PodID("pod1"), k8s.DefaultNamespace, "main")
+	defer sub.teardown()
+
+	require.Eventually(t, func() bool {
+		return st.content() == "line1\n"
+	}, time.Second, 10*time.Millisecond)
+
+	// The fake client only has one stream; once it's exhausted it reports
+	// "container not found", which is terminal -- the subscriber should give
+	// up rather than keep retrying forever.
+	time.Sleep(50 * time.Millisecond)
+	callsAfterSettle := client.callCount()
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, callsAfterSettle, client.callCount())
+}
+
+// TestPodLogManagerOpensSubscriberForRunningContainer drives
+// PodLogManager.OnChange off a pod that went through the real
+// k8sconv.Pod conversion, to prove the full PodWatcher -> store ->
+// PodLogManager pipeline actually opens a subscriber for a running
+// container, rather than just exercising podLogSubscriber in isolation.
+func TestPodLogManagerOpensSubscriberForRunningContainer(t *testing.T) {
+	f := tempdir.NewTempDirFixture(t)
+	defer f.TearDown()
+
+	ctx, _, _ := testutils.CtxAndAnalyticsForTest()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	kCli := k8s.NewFakeK8sClient()
+	defer kCli.TearDown()
+
+	m := NewPodLogManager(kCli)
+
+	st := store.NewStore(store.Reducer(func(ctx context.Context, state *store.EngineState, action store.Action) {}), store.LogActionsFlag(false))
+	go func() {
+		_ = st.Loop(ctx)
+	}()
+
+	manifest := manifestbuilder.New(f, model.ManifestName("server")).
+		WithK8sYAML(testyaml.SanchoYAML).
+		Build()
+
+	corePod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+	corePod.Name = "pod1"
+	convertedPod := k8sconv.Pod(ctx, corePod)
+	require.Equal(t, []string{"main"}, runningContainerNames(*convertedPod),
+		"k8sconv.Pod should carry the running container through so PodLogManager can find it")
+
+	state := st.LockMutableStateForTesting()
+	mt := store.NewManifestTarget(manifest)
+	state.UpsertManifestTarget(mt)
+	mState, ok := state.ManifestState(manifest.Name)
+	require.True(t, ok)
+	runtimeState := mState.K8sRuntimeState()
+	runtimeState.Pods = []v1alpha1.Pod{*convertedPod}
+	mState.RuntimeState = runtimeState
+	st.UnlockMutableState()
+
+	m.OnChange(ctx, st, store.LegacyChangeSummary())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	require.Len(t, m.subscribers, 1, "expected a subscriber to be opened for the running container")
+}
+
+// TestPodLogManagerOpensSubscriberPerRunningContainer proves a pod with two
+// concurrently-running containers (e.g. a sidecar alongside the main
+// container) gets a podLogSubscriber for each one, not just the first.
+func TestPodLogManagerOpensSubscriberPerRunningContainer(t *testing.T) {
+	f := tempdir.NewTempDirFixture(t)
+	defer f.TearDown()
+
+	ctx, _, _ := testutils.CtxAndAnalyticsForTest()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	kCli := k8s.NewFakeK8sClient()
+	defer kCli.TearDown()
+
+	m := NewPodLogManager(kCli)
+
+	st := store.NewStore(store.Reducer(func(ctx context.Context, state *store.EngineState, action store.Action) {}), store.LogActionsFlag(false))
+	go func() {
+		_ = st.Loop(ctx)
+	}()
+
+	manifest := manifestbuilder.New(f, model.ManifestName("server")).
+		WithK8sYAML(testyaml.SanchoYAML).
+		Build()
+
+	corePod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "sidecar", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+	corePod.Name = "pod1"
+	convertedPod := k8sconv.Pod(ctx, corePod)
+	require.Equal(t, []string{"main", "sidecar"}, runningContainerNames(*convertedPod))
+
+	state := st.LockMutableStateForTesting()
+	mt := store.NewManifestTarget(manifest)
+	state.UpsertManifestTarget(mt)
+	mState, ok := state.ManifestState(manifest.Name)
+	require.True(t, ok)
+	runtimeState := mState.K8sRuntimeState()
+	runtimeState.Pods = []v1alpha1.Pod{*convertedPod}
+	mState.RuntimeState = runtimeState
+	st.UnlockMutableState()
+
+	m.OnChange(ctx, st, store.LegacyChangeSummary())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	require.Len(t, m.subscribers, 2, "expected a subscriber for each concurrently-running container")
+	for key := range m.subscribers {
+		assert.Contains(t, []string{"main", "sidecar"}, key.containerName)
+	}
+}
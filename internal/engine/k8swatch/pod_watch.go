@@ -0,0 +1,296 @@
+package k8swatch
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tilt-dev/tilt/internal/k8s"
+	"github.com/tilt-dev/tilt/internal/store"
+	"github.com/tilt-dev/tilt/internal/store/k8sconv"
+	"github.com/tilt-dev/tilt/pkg/apis/core/v1alpha1"
+	"github.com/tilt-dev/tilt/pkg/model"
+)
+
+// PodChangeAction is dispatched whenever the PodWatcher observes a pod that
+// belongs to one of the deployed manifests.
+type PodChangeAction struct {
+	Pod          *v1alpha1.Pod
+	ManifestName model.ManifestName
+}
+
+func (PodChangeAction) Action() {}
+
+func NewPodChangeAction(pod *v1alpha1.Pod, manifestName model.ManifestName) PodChangeAction {
+	return PodChangeAction{Pod: pod, ManifestName: manifestName}
+}
+
+// manifestSelectors records how to recognize a manifest's pods: either
+// because they descend (via owner references) from one of the manifest's
+// deployed entities, or because they match one of its extra_pod_selectors,
+// which can use the full set of metav1.LabelSelector operators (equality,
+// In, NotIn, Exists, DoesNotExist) rather than just label equality.
+type manifestSelectors struct {
+	deployedUIDs map[types.UID]bool
+	extra        []labels.Selector
+}
+
+// extraPodSelectorsToLabelSelectors converts a manifest's extra_pod_selectors
+// into label.Selectors it can match pods against. An entry that fails to
+// convert (e.g. a malformed operator) is dropped rather than treated as
+// fatal, since a bad selector shouldn't take down the whole watcher.
+//
+// This expects m.K8sTarget().ExtraPodSelectors to already be
+// []metav1.LabelSelector, not []labels.Set, so it can express the full set
+// of operators (In, NotIn, Exists, DoesNotExist), not just equality.
+func extraPodSelectorsToLabelSelectors(selectors []metav1.LabelSelector, log logr.Logger) []labels.Selector {
+	var out []labels.Selector
+	for _, ls := range selectors {
+		sel, err := metav1.LabelSelectorAsSelector(&ls)
+		if err != nil {
+			log.Error(err, "invalid extra_pod_selectors entry")
+			continue
+		}
+		out = append(out, sel)
+	}
+	return out
+}
+
+func (s *manifestSelectors) matches(pod *corev1.Pod, ancestorUIDs []types.UID) bool {
+	for _, uid := range ancestorUIDs {
+		if s.deployedUIDs[uid] {
+			return true
+		}
+	}
+
+	podLabels := labels.Set(pod.Labels)
+	for _, sel := range s.extra {
+		if sel.Matches(podLabels) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PodWatcher watches every pod in the cluster and, for each one, figures out
+// which (if any) manifest it belongs to, then dispatches a PodChangeAction.
+type PodWatcher struct {
+	mu sync.Mutex
+
+	kCli             k8s.Client
+	ownerFetcher     k8s.OwnerFetcher
+	defaultNamespace k8s.Namespace
+
+	watching          bool
+	manifestSelectors map[model.ManifestName]*manifestSelectors
+
+	// podCache holds every pod we've ever seen on the watch stream, keyed by
+	// UID, so that OnChange can re-evaluate them against manifests whose
+	// selectors/deployed entities changed after the pod was first observed.
+	podCache map[types.UID]*corev1.Pod
+
+	// dispatched records the manifest each cached pod was last dispatched
+	// under, so a rescan triggered by OnChange only re-dispatches pods whose
+	// match actually changed.
+	dispatched map[types.UID]model.ManifestName
+
+	// disruptionReasons preserves the last-observed DisruptionTarget reason
+	// for a pod UID, since the apiserver can drop the condition on a later
+	// update (e.g. right before the pod is actually deleted).
+	disruptionReasons map[types.UID]v1alpha1.PodCondition
+}
+
+func NewPodWatcher(kCli k8s.Client, ownerFetcher k8s.OwnerFetcher, defaultNamespace k8s.Namespace) *PodWatcher {
+	return &PodWatcher{
+		kCli:              kCli,
+		ownerFetcher:      ownerFetcher,
+		defaultNamespace:  defaultNamespace,
+		manifestSelectors: make(map[model.ManifestName]*manifestSelectors),
+		podCache:          make(map[types.UID]*corev1.Pod),
+		dispatched:        make(map[types.UID]model.ManifestName),
+		disruptionReasons: make(map[types.UID]v1alpha1.PodCondition),
+	}
+}
+
+func (w *PodWatcher) OnChange(ctx context.Context, st store.RStore, summary store.ChangeSummary) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state := st.RLockState()
+	seen := make(map[model.ManifestName]bool)
+	for _, mt := range state.Targets() {
+		m := mt.Manifest
+		if !m.IsK8s() {
+			continue
+		}
+		seen[m.Name] = true
+
+		sel := w.manifestSelectors[m.Name]
+		if sel == nil {
+			sel = &manifestSelectors{}
+			w.manifestSelectors[m.Name] = sel
+		}
+		sel.extra = extraPodSelectorsToLabelSelectors(m.K8sTarget().ExtraPodSelectors, log)
+
+		deployedUIDs := make(map[types.UID]bool)
+		runtimeState := mt.State.K8sRuntimeState()
+		for _, ref := range runtimeState.DeployedEntities {
+			deployedUIDs[ref.UID] = true
+		}
+		sel.deployedUIDs = deployedUIDs
+	}
+	st.RUnlockState()
+
+	for name := range w.manifestSelectors {
+		if !seen[name] {
+			delete(w.manifestSelectors, name)
+		}
+	}
+	for uid, name := range w.dispatched {
+		if !seen[name] {
+			delete(w.dispatched, uid)
+		}
+	}
+
+	w.rescanLocked(ctx, st, log)
+
+	if !w.watching && len(seen) > 0 {
+		w.watching = true
+		go w.watchLoop(ctx, st, log)
+	}
+}
+
+func (w *PodWatcher) watchLoop(ctx context.Context, st store.RStore, log logr.Logger) {
+	ch, err := w.kCli.WatchPods(ctx, w.defaultNamespace)
+	if err != nil {
+		log.Error(err, "watching pods")
+		return
+	}
+
+	// Events come off the watch stream keyed by UID but not guaranteed to
+	// arrive (or be dispatched) in resourceVersion order; the queue buffers
+	// each UID's events for a short window so handlePod only ever sees them
+	// in RV order.
+	queue := newPodEventQueue(podRVWindow, func(pod *corev1.Pod) {
+		podLog := log.WithValues("pod", pod.UID, "namespace", pod.Namespace)
+		w.handlePod(ctx, st, pod, podLog)
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pod, ok := <-ch:
+			if !ok {
+				return
+			}
+			queue.add(pod)
+		}
+	}
+}
+
+func (w *PodWatcher) ancestorUIDs(ctx context.Context, pod *corev1.Pod, log logr.Logger) []types.UID {
+	uids, err := w.ownerFetcher.OwnerUIDs(ctx, pod)
+	if err != nil || len(uids) == 0 {
+		if err != nil {
+			log.Error(err, "fetching pod owners")
+		}
+		return []types.UID{pod.UID}
+	}
+	return uids
+}
+
+func (w *PodWatcher) matchLocked(pod *corev1.Pod, ancestorUIDs []types.UID) (model.ManifestName, bool) {
+	for name, sel := range w.manifestSelectors {
+		if sel.matches(pod, ancestorUIDs) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// evictLocked forgets everything PodWatcher has cached for uid, e.g. once
+// its pod has been deleted, so a long-running watch doesn't leak an entry
+// per UID forever across pod churn.
+func (w *PodWatcher) evictLocked(uid types.UID) {
+	delete(w.podCache, uid)
+	delete(w.dispatched, uid)
+	delete(w.disruptionReasons, uid)
+}
+
+// handlePod processes a pod observed directly off the watch stream. Unlike
+// rescanLocked, every matching event is dispatched even if the pod's
+// manifest match is unchanged, since the pod's contents (status,
+// containers, disruption reason, etc.) may have changed.
+func (w *PodWatcher) handlePod(ctx context.Context, st store.RStore, pod *corev1.Pod, log logr.Logger) {
+	ancestorUIDs := w.ancestorUIDs(ctx, pod, log)
+	deleted := pod.DeletionTimestamp != nil
+
+	w.mu.Lock()
+	if !deleted {
+		// Once a pod is being deleted there's no reason to keep it around
+		// for rescanLocked to re-evaluate -- it's evicted below instead.
+		w.podCache[pod.UID] = pod
+	}
+
+	name, ok := w.matchLocked(pod, ancestorUIDs)
+	if !ok {
+		if deleted {
+			w.evictLocked(pod.UID)
+		}
+		w.mu.Unlock()
+		return
+	}
+	w.dispatched[pod.UID] = name
+	action := w.buildActionLocked(ctx, pod, name)
+	if deleted {
+		w.evictLocked(pod.UID)
+	}
+	w.mu.Unlock()
+
+	log.WithValues("manifest", name).Info("dispatching pod change")
+	st.Dispatch(action)
+}
+
+// rescanLocked re-evaluates every cached pod against the current set of
+// manifest selectors. It only dispatches a pod whose manifest match has
+// changed since the last time we looked, so an OnChange call that doesn't
+// affect a given pod's match is a no-op for it.
+func (w *PodWatcher) rescanLocked(ctx context.Context, st store.RStore, log logr.Logger) {
+	for uid, pod := range w.podCache {
+		podLog := log.WithValues("pod", uid, "namespace", pod.Namespace)
+		ancestorUIDs := w.ancestorUIDs(ctx, pod, podLog)
+		name, ok := w.matchLocked(pod, ancestorUIDs)
+		if !ok || w.dispatched[uid] == name {
+			continue
+		}
+		w.dispatched[uid] = name
+		action := w.buildActionLocked(ctx, pod, name)
+		podLog.WithValues("manifest", name).Info("dispatching pod change on rescan")
+		st.Dispatch(action)
+	}
+}
+
+func (w *PodWatcher) buildActionLocked(ctx context.Context, pod *corev1.Pod, name model.ManifestName) PodChangeAction {
+	converted := k8sconv.Pod(ctx, pod)
+
+	if converted.DisruptionReason != "" {
+		w.disruptionReasons[pod.UID] = v1alpha1.PodCondition{
+			Reason:  converted.DisruptionReason,
+			Message: converted.DisruptionMessage,
+		}
+	} else if last, ok := w.disruptionReasons[pod.UID]; ok {
+		converted.DisruptionReason = last.Reason
+		converted.DisruptionMessage = last.Message
+	}
+
+	return NewPodChangeAction(converted, name)
+}
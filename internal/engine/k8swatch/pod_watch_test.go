@@ -11,10 +11,12 @@ import (
 
 	"github.com/tilt-dev/tilt/internal/store/k8sconv"
 
+	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/tilt-dev/tilt/internal/k8s"
@@ -27,6 +29,91 @@ import (
 	"github.com/tilt-dev/tilt/pkg/model"
 )
 
+// capturingLogSink is a minimal logr.LogSink that records the key/value
+// pairs attached (directly or via WithValues) to each log line, so tests can
+// assert that a watcher tagged its output with the object it concerns.
+type capturingLogSink struct {
+	mu      *sync.Mutex
+	entries *[]map[string]interface{}
+	values  []interface{}
+}
+
+func newCapturingLogSink() *capturingLogSink {
+	return &capturingLogSink{mu: &sync.Mutex{}, entries: &[]map[string]interface{}{}}
+}
+
+func (s *capturingLogSink) Init(logr.RuntimeInfo) {}
+func (s *capturingLogSink) Enabled(int) bool      { return true }
+
+func (s *capturingLogSink) record(msg string, keysAndValues []interface{}) {
+	entry := map[string]interface{}{"msg": msg}
+	for i := 0; i+1 < len(s.values); i += 2 {
+		entry[s.values[i].(string)] = s.values[i+1]
+	}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		entry[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.entries = append(*s.entries, entry)
+}
+
+func (s *capturingLogSink) Info(_ int, msg string, keysAndValues ...interface{}) {
+	s.record(msg, keysAndValues)
+}
+
+func (s *capturingLogSink) Error(_ error, msg string, keysAndValues ...interface{}) {
+	s.record(msg, keysAndValues)
+}
+
+func (s *capturingLogSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &capturingLogSink{
+		mu:      s.mu,
+		entries: s.entries,
+		values:  append(append([]interface{}{}, s.values...), keysAndValues...),
+	}
+}
+
+func (s *capturingLogSink) WithName(string) logr.LogSink { return s }
+
+func (s *capturingLogSink) allEntries() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}{}, (*s.entries)...)
+}
+
+func TestPodWatchLogsAreTaggedWithObject(t *testing.T) {
+	f := newPWFixture(t)
+	defer f.TearDown()
+
+	sink := newCapturingLogSink()
+	f.ctx = logr.NewContext(f.ctx, logr.New(sink))
+
+	manifest := f.addManifestWithSelectors("server")
+
+	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+	pb := podbuilder.New(t, manifest)
+	p := pb.Build()
+	entities := pb.ObjectTreeEntities()
+	f.addDeployedEntity(manifest, entities.Deployment())
+	f.kClient.InjectEntityByName(entities...)
+	f.kClient.EmitPod(labels.Everything(), p)
+
+	f.assertObservedPods(p)
+
+	var found bool
+	for _, e := range sink.allEntries() {
+		if e["manifest"] == manifest.Name && e["pod"] == p.UID && e["namespace"] == p.Namespace {
+			found = true
+			break
+		}
+	}
+	assert.True(t, found, "expected a log line tagged with manifest=%s pod=%s namespace=%s, got %v",
+		manifest.Name, p.UID, p.Namespace, sink.allEntries())
+}
+
 func TestPodWatch(t *testing.T) {
 	f := newPWFixture(t)
 	defer f.TearDown()
@@ -107,7 +194,7 @@ func TestPodWatchExtraSelectors(t *testing.T) {
 
 	ls1 := labels.Set{"foo": "bar"}
 	ls2 := labels.Set{"baz": "quu"}
-	manifest := f.addManifestWithSelectors("server", ls1, ls2)
+	manifest := f.addManifestWithSelectors("server", eqSelector(ls1), eqSelector(ls2))
 
 	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
 
@@ -121,12 +208,80 @@ func TestPodWatchExtraSelectors(t *testing.T) {
 	f.assertObservedManifests(manifest.Name)
 }
 
+// TestPodWatchExtraSelectorsSetBasedOperators exercises each of the
+// set-based metav1.LabelSelectorRequirement operators that
+// extra_pod_selectors can now express, beyond plain label equality.
+func TestPodWatchExtraSelectorsSetBasedOperators(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		selector metav1.LabelSelector
+		matches  labels.Set
+		nonMatch labels.Set
+	}{
+		{
+			name: "In",
+			selector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"staging", "canary"}},
+			}},
+			matches:  labels.Set{"env": "canary"},
+			nonMatch: labels.Set{"env": "prod"},
+		},
+		{
+			name: "NotIn",
+			selector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "env", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"prod"}},
+			}},
+			matches:  labels.Set{"env": "staging"},
+			nonMatch: labels.Set{"env": "prod"},
+		},
+		{
+			name: "Exists",
+			selector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "canary", Operator: metav1.LabelSelectorOpExists},
+			}},
+			matches:  labels.Set{"canary": "true"},
+			nonMatch: labels.Set{"other": "true"},
+		},
+		{
+			name: "DoesNotExist",
+			selector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "canary", Operator: metav1.LabelSelectorOpDoesNotExist},
+			}},
+			matches:  labels.Set{"other": "true"},
+			nonMatch: labels.Set{"canary": "true"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newPWFixture(t)
+			defer f.TearDown()
+
+			manifest := f.addManifestWithSelectors("server", tc.selector)
+			f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+			nonMatching := podbuilder.New(t, manifest).WithPodID("non-match")
+			for k, v := range tc.nonMatch {
+				nonMatching = nonMatching.WithPodLabel(k, v)
+			}
+			f.kClient.EmitPod(labels.Everything(), nonMatching.WithUnknownOwner().Build())
+
+			matching := podbuilder.New(t, manifest)
+			for k, v := range tc.matches {
+				matching = matching.WithPodLabel(k, v)
+			}
+			p := matching.WithUnknownOwner().Build()
+			f.kClient.EmitPod(labels.Everything(), p)
+
+			f.assertObservedPods(p)
+		})
+	}
+}
+
 func TestPodWatchHandleSelectorChange(t *testing.T) {
 	f := newPWFixture(t)
 	defer f.TearDown()
 
 	ls1 := labels.Set{"foo": "bar"}
-	manifest := f.addManifestWithSelectors("server1", ls1)
+	manifest := f.addManifestWithSelectors("server1", eqSelector(ls1))
 
 	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
 
@@ -140,7 +295,7 @@ func TestPodWatchHandleSelectorChange(t *testing.T) {
 	f.clearPods()
 
 	ls2 := labels.Set{"baz": "quu"}
-	manifest2 := f.addManifestWithSelectors("server2", ls2)
+	manifest2 := f.addManifestWithSelectors("server2", eqSelector(ls2))
 	f.removeManifest("server1")
 
 	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
@@ -190,6 +345,8 @@ func TestPodsDispatchedInOrder(t *testing.T) {
 	f.addDeployedEntity(manifest, entities.Deployment())
 	f.kClient.InjectEntityByName(entities...)
 
+	// Each update is emitted well outside the queue's debounce window, so
+	// they should each get their own dispatch rather than being coalesced.
 	count := 20
 	pods := []*v1.Pod{}
 	for i := 0; i < count; i++ {
@@ -203,6 +360,7 @@ func TestPodsDispatchedInOrder(t *testing.T) {
 
 	for _, pod := range pods {
 		f.kClient.EmitPod(labels.Everything(), pod)
+		time.Sleep(2 * podRVWindow)
 	}
 
 	f.waitForPodActionCount(count)
@@ -219,6 +377,100 @@ func TestPodsDispatchedInOrder(t *testing.T) {
 	}
 }
 
+// A burst of updates for the same pod UID within the debounce window should
+// collapse into a single dispatch of the highest resourceVersion, rather
+// than dispatching (or dropping) them arbitrarily.
+func TestPodWatchCoalescesBurstsOfSameUID(t *testing.T) {
+	f := newPWFixture(t)
+	defer f.TearDown()
+
+	manifest := f.addManifestWithSelectors("server")
+	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+	pb := podbuilder.New(t, manifest)
+	entities := pb.ObjectTreeEntities()
+	f.addDeployedEntity(manifest, entities.Deployment())
+	f.kClient.InjectEntityByName(entities...)
+
+	for i := 0; i < 5; i++ {
+		v := strconv.Itoa(i)
+		f.kClient.EmitPod(labels.Everything(), pb.
+			WithResourceVersion(v).
+			WithTemplateSpecHash(k8s.PodTemplateSpecHash(v)).
+			Build())
+	}
+
+	f.waitForPodActionCount(1)
+	time.Sleep(2 * podRVWindow)
+	f.mu.Lock()
+	dispatchCount := len(f.pods)
+	lastHash := f.pods[len(f.pods)-1].PodTemplateSpecHash
+	f.mu.Unlock()
+
+	assert.Equal(t, 1, dispatchCount, "expected the burst to coalesce into a single dispatch")
+	assert.Equal(t, k8s.PodTemplateSpecHash("4"), lastHash)
+}
+
+// Interleaved updates for multiple pod UIDs should each stay monotonic by
+// resourceVersion, while the relative dispatch order across UIDs tracks
+// arrival order.
+// Events for two pod UIDs, genuinely interleaved within a single debounce
+// window (including arriving out of RV order within that window), must
+// still leave each UID's own dispatched stream monotonic by resourceVersion.
+// The implementation gives each UID its own independent debounce timer, so
+// this intentionally does not assert anything about the relative dispatch
+// order *between* A and B -- only that neither UID's stream ever regresses.
+func TestPodWatchResourceVersionOrderingAcrossUIDs(t *testing.T) {
+	f := newPWFixture(t)
+	defer f.TearDown()
+
+	ls := labels.Set{"foo": "bar"}
+	manifest := f.addManifestWithSelectors("server", eqSelector(ls))
+	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+	pbA := podbuilder.New(t, manifest).WithPodID("pod-a").WithPodLabel("foo", "bar").WithUnknownOwner()
+	pbB := podbuilder.New(t, manifest).WithPodID("pod-b").WithPodLabel("foo", "bar").WithUnknownOwner()
+
+	// Round 1: A and B's first updates, interleaved with no delay at all --
+	// both land in the same debounce window as each other (but not as
+	// round 2, below).
+	f.kClient.EmitPod(labels.Everything(), pbA.WithResourceVersion("1").WithTemplateSpecHash(k8s.PodTemplateSpecHash("1")).Build())
+	f.kClient.EmitPod(labels.Everything(), pbB.WithResourceVersion("1").WithTemplateSpecHash(k8s.PodTemplateSpecHash("1")).Build())
+	f.waitForPodActionCount(2)
+
+	// Round 2: for pod A, emit RV 3 before RV 2 -- genuinely out of order
+	// within the same window -- interleaved with pod B's RV 2. The queue
+	// should still only ever dispatch A's highest RV (3), never regressing
+	// to 2 after having already seen 3.
+	podA3 := pbA.WithResourceVersion("3").WithTemplateSpecHash(k8s.PodTemplateSpecHash("3")).Build()
+	podA2 := pbA.WithResourceVersion("2").WithTemplateSpecHash(k8s.PodTemplateSpecHash("2")).Build()
+	podB2 := pbB.WithResourceVersion("2").WithTemplateSpecHash(k8s.PodTemplateSpecHash("2")).Build()
+	f.kClient.EmitPod(labels.Everything(), podA3)
+	f.kClient.EmitPod(labels.Everything(), podB2)
+	f.kClient.EmitPod(labels.Everything(), podA2)
+
+	f.waitForPodActionCount(4)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	require.Len(t, f.pods, 4)
+
+	var aHashes, bHashes []string
+	for _, p := range f.pods {
+		switch p.Name {
+		case podA3.Name:
+			aHashes = append(aHashes, p.PodTemplateSpecHash)
+		case podB2.Name:
+			bHashes = append(bHashes, p.PodTemplateSpecHash)
+		}
+	}
+	// Pod A dispatched RV 1, then RV 3 -- never regressing to RV 2, even
+	// though RV 2 arrived after RV 3 within the same window. Pod B simply
+	// dispatched its two RVs in order.
+	assert.Equal(t, []string{"1", "3"}, aHashes)
+	assert.Equal(t, []string{"1", "2"}, bHashes)
+}
+
 func TestPodWatchReadd(t *testing.T) {
 	f := newPWFixture(t)
 	defer f.TearDown()
@@ -251,7 +503,210 @@ func TestPodWatchReadd(t *testing.T) {
 	f.assertObservedPods(p)
 }
 
-func (f *pwFixture) addManifestWithSelectors(manifestName string, ls ...labels.Set) model.Manifest {
+// Kubernetes sets a DisruptionTarget condition on a pod to explain why it's
+// being torn down (preemption, node drain, eviction, etc). Make sure that
+// reason makes it all the way to the dispatched PodChangeAction.
+func TestPodWatchDisruptionTarget(t *testing.T) {
+	reasons := []string{
+		"PreemptionByKubeScheduler",
+		"DeletionByTaintManager",
+		"EvictionByEvictionAPI",
+		"DeletionByPodGC",
+	}
+
+	for _, reason := range reasons {
+		reason := reason
+		t.Run(reason, func(t *testing.T) {
+			f := newPWFixture(t)
+			defer f.TearDown()
+
+			manifest := f.addManifestWithSelectors("server")
+
+			f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+			pb := podbuilder.New(t, manifest)
+			p := pb.Build()
+			p.Status.Conditions = append(p.Status.Conditions, corev1.PodCondition{
+				Type:    "DisruptionTarget",
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: "pod is being disrupted: " + reason,
+			})
+
+			entities := pb.ObjectTreeEntities()
+			f.addDeployedEntity(manifest, entities.Deployment())
+			f.kClient.InjectEntityByName(entities...)
+
+			f.kClient.EmitPod(labels.Everything(), p)
+
+			f.waitForPodActionCount(1)
+			assert.Equal(t, reason, f.pods[0].DisruptionReason)
+			assert.Equal(t, "pod is being disrupted: "+reason, f.pods[0].DisruptionMessage)
+		})
+	}
+}
+
+// The apiserver can drop the DisruptionTarget condition on the very last
+// update before a pod disappears. Tilt should keep reporting the reason it
+// last observed, so the UI can still explain why the pod died.
+func TestPodWatchDisruptionTargetPreservedAcrossUpdates(t *testing.T) {
+	f := newPWFixture(t)
+	defer f.TearDown()
+
+	manifest := f.addManifestWithSelectors("server")
+
+	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+	pb := podbuilder.New(t, manifest).WithResourceVersion("1")
+	entities := pb.ObjectTreeEntities()
+	f.addDeployedEntity(manifest, entities.Deployment())
+	f.kClient.InjectEntityByName(entities...)
+
+	p1 := pb.Build()
+	p1.Status.Conditions = append(p1.Status.Conditions, corev1.PodCondition{
+		Type:   "DisruptionTarget",
+		Status: corev1.ConditionTrue,
+		Reason: "EvictionByEvictionAPI",
+	})
+	f.kClient.EmitPod(labels.Everything(), p1)
+	f.waitForPodActionCount(1)
+	assert.Equal(t, "EvictionByEvictionAPI", f.pods[0].DisruptionReason)
+
+	// The follow-up update drops the condition entirely, as the apiserver
+	// does right before the pod is deleted.
+	p2 := pb.WithResourceVersion("2").Build()
+	f.kClient.EmitPod(labels.Everything(), p2)
+	f.waitForPodActionCount(2)
+	assert.Equal(t, "EvictionByEvictionAPI", f.pods[1].DisruptionReason)
+}
+
+// Same as above, but the condition-dropping update arrives within the
+// queue's debounce window of the condition-bearing one, instead of after
+// it's already been dispatched. The disruption-bearing event must not get
+// coalesced away by the follow-up, or the UI never learns why the pod died.
+func TestPodWatchDisruptionTargetPreservedWithinDebounceWindow(t *testing.T) {
+	f := newPWFixture(t)
+	defer f.TearDown()
+
+	manifest := f.addManifestWithSelectors("server")
+
+	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+	pb := podbuilder.New(t, manifest).WithResourceVersion("1")
+	entities := pb.ObjectTreeEntities()
+	f.addDeployedEntity(manifest, entities.Deployment())
+	f.kClient.InjectEntityByName(entities...)
+
+	p1 := pb.Build()
+	p1.Status.Conditions = append(p1.Status.Conditions, corev1.PodCondition{
+		Type:   "DisruptionTarget",
+		Status: corev1.ConditionTrue,
+		Reason: "EvictionByEvictionAPI",
+	})
+	p2 := pb.WithResourceVersion("2").Build()
+
+	// Emit both back-to-back, well within podRVWindow of each other -- no
+	// wait for the first to be dispatched before sending the second.
+	f.kClient.EmitPod(labels.Everything(), p1)
+	f.kClient.EmitPod(labels.Everything(), p2)
+
+	f.waitForPodActionCount(2)
+	assert.Equal(t, "EvictionByEvictionAPI", f.pods[0].DisruptionReason)
+	assert.Equal(t, "EvictionByEvictionAPI", f.pods[1].DisruptionReason)
+}
+
+// A non-disruption event that's already buffered for a UID must not flush
+// out *after* a later DisruptionTarget event for the same UID bypasses the
+// queue -- that would dispatch the older, lower-RV event last, regressing
+// lastDispatchedRV and reordering the stream.
+func TestPodWatchDisruptionTargetNotSupersededByPendingEvent(t *testing.T) {
+	f := newPWFixture(t)
+	defer f.TearDown()
+
+	manifest := f.addManifestWithSelectors("server")
+
+	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+	pb := podbuilder.New(t, manifest).WithResourceVersion("1")
+	entities := pb.ObjectTreeEntities()
+	f.addDeployedEntity(manifest, entities.Deployment())
+	f.kClient.InjectEntityByName(entities...)
+
+	p1 := pb.Build()
+	p2 := pb.WithResourceVersion("2").Build()
+	p2.Status.Conditions = append(p2.Status.Conditions, corev1.PodCondition{
+		Type:   "DisruptionTarget",
+		Status: corev1.ConditionTrue,
+		Reason: "EvictionByEvictionAPI",
+	})
+
+	// p1 (no condition) starts the debounce window and sits buffered. p2
+	// (DisruptionTarget) arrives before that window closes and bypasses it
+	// entirely. Once the original window does close, p1 must not flush out
+	// behind p2.
+	f.kClient.EmitPod(labels.Everything(), p1)
+	f.kClient.EmitPod(labels.Everything(), p2)
+
+	f.waitForPodActionCount(1)
+	time.Sleep(2 * podRVWindow)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	require.Len(t, f.pods, 1, "the superseded p1 must not flush out after p2 dispatched")
+	assert.Equal(t, "EvictionByEvictionAPI", f.pods[0].DisruptionReason)
+}
+
+// Once a pod is deleted, PodWatcher must stop tracking it in podCache,
+// dispatched, and disruptionReasons -- otherwise a long-running session
+// watching a cluster with any pod churn leaks one entry per UID per map
+// forever.
+func TestPodWatchEvictsDeletedPod(t *testing.T) {
+	f := newPWFixture(t)
+	defer f.TearDown()
+
+	manifest := f.addManifestWithSelectors("server")
+
+	f.pw.OnChange(f.ctx, f.store, store.LegacyChangeSummary())
+
+	pb := podbuilder.New(t, manifest).WithResourceVersion("1")
+	entities := pb.ObjectTreeEntities()
+	f.addDeployedEntity(manifest, entities.Deployment())
+	f.kClient.InjectEntityByName(entities...)
+
+	p1 := pb.Build()
+	p1.Status.Conditions = append(p1.Status.Conditions, corev1.PodCondition{
+		Type:   "DisruptionTarget",
+		Status: corev1.ConditionTrue,
+		Reason: "EvictionByEvictionAPI",
+	})
+	f.kClient.EmitPod(labels.Everything(), p1)
+	f.waitForPodActionCount(1)
+
+	uid := p1.UID
+	f.pw.mu.Lock()
+	_, cached := f.pw.podCache[uid]
+	_, hasReason := f.pw.disruptionReasons[uid]
+	f.pw.mu.Unlock()
+	require.True(t, cached)
+	require.True(t, hasReason)
+
+	deletionTime := metav1.Now()
+	p2 := pb.WithResourceVersion("2").Build()
+	p2.DeletionTimestamp = &deletionTime
+	f.kClient.EmitPod(labels.Everything(), p2)
+	f.waitForPodActionCount(2)
+
+	f.pw.mu.Lock()
+	defer f.pw.mu.Unlock()
+	_, cached = f.pw.podCache[uid]
+	_, dispatched := f.pw.dispatched[uid]
+	_, hasReason = f.pw.disruptionReasons[uid]
+	assert.False(t, cached, "podCache should be evicted once a pod is deleted")
+	assert.False(t, dispatched, "dispatched should be evicted once a pod is deleted")
+	assert.False(t, hasReason, "disruptionReasons should be evicted once a pod is deleted")
+}
+
+func (f *pwFixture) addManifestWithSelectors(manifestName string, ls ...metav1.LabelSelector) model.Manifest {
 	state := f.store.LockMutableStateForTesting()
 	m := manifestbuilder.New(f, model.ManifestName(manifestName)).
 		WithK8sYAML(testyaml.SanchoYAML).
@@ -263,6 +718,12 @@ func (f *pwFixture) addManifestWithSelectors(manifestName string, ls ...labels.S
 	return mt.Manifest
 }
 
+// eqSelector builds an equality-only metav1.LabelSelector from a label set,
+// for tests that don't care about the set-based operators.
+func eqSelector(set labels.Set) metav1.LabelSelector {
+	return metav1.LabelSelector{MatchLabels: map[string]string(set)}
+}
+
 func (f *pwFixture) removeManifest(mn model.ManifestName) {
 	state := f.store.LockMutableStateForTesting()
 	state.RemoveManifestTarget(mn)
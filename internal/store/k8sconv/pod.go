@@ -0,0 +1,97 @@
+package k8sconv
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tilt-dev/tilt/internal/k8s"
+	"github.com/tilt-dev/tilt/pkg/apis/core/v1alpha1"
+)
+
+// disruptionTargetCondition is the pod condition type Kubernetes sets to
+// explain an in-progress eviction/preemption/GC of a pod, e.g.
+// PreemptionByKubeScheduler, DeletionByTaintManager, EvictionByEvictionAPI,
+// or DeletionByPodGC.
+const disruptionTargetCondition corev1.PodConditionType = "DisruptionTarget"
+
+// HasDisruptionCondition reports whether pod currently carries a
+// DisruptionTarget condition, so callers that buffer or reorder pod events
+// (e.g. PodWatcher's event queue) can avoid dropping one -- Kubernetes can
+// remove the condition again on the very next update, so an event carrying
+// it may be the only chance to observe why a pod is being torn down.
+func HasDisruptionCondition(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == disruptionTargetCondition && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// Pod converts a Kubernetes API pod into Tilt's internal read model.
+func Pod(ctx context.Context, pod *corev1.Pod) *v1alpha1.Pod {
+	p := &v1alpha1.Pod{
+		Name:                pod.Name,
+		Namespace:           pod.Namespace,
+		PodTemplateSpecHash: pod.Labels[k8s.TiltPodTemplateHashLabel],
+		CreatedAt:           pod.CreationTimestamp,
+		Phase:               string(pod.Status.Phase),
+		Deleted:             pod.DeletionTimestamp != nil,
+	}
+
+	for _, c := range pod.Status.Conditions {
+		p.Conditions = append(p.Conditions, v1alpha1.PodCondition{
+			Type:    string(c.Type),
+			Status:  string(c.Status),
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+
+		if c.Type == disruptionTargetCondition && c.Status == corev1.ConditionTrue {
+			// Pass the reason through unchanged -- Kubernetes adds new
+			// DisruptionTarget reasons over time, and we don't want to drop
+			// ones Tilt doesn't know about yet.
+			p.DisruptionReason = c.Reason
+			p.DisruptionMessage = c.Message
+		}
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		p.Containers = append(p.Containers, containerStatus(cs))
+	}
+	for _, cs := range pod.Status.InitContainerStatuses {
+		p.InitContainers = append(p.InitContainers, containerStatus(cs))
+	}
+
+	return p
+}
+
+// containerStatus converts a Kubernetes container status into Tilt's
+// internal read model.
+func containerStatus(cs corev1.ContainerStatus) v1alpha1.Container {
+	return v1alpha1.Container{
+		Name:     cs.Name,
+		ID:       cs.ContainerID,
+		Image:    cs.Image,
+		Ready:    cs.Ready,
+		Restarts: cs.RestartCount,
+		State:    containerState(cs.State),
+	}
+}
+
+// containerState maps a corev1.ContainerState to the string states Tilt's
+// model uses ("running", "waiting", "terminated"), matching the condition
+// runningContainerName checks for.
+func containerState(s corev1.ContainerState) string {
+	switch {
+	case s.Running != nil:
+		return "running"
+	case s.Terminated != nil:
+		return "terminated"
+	case s.Waiting != nil:
+		return "waiting"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,57 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Pod is Tilt's read-only model of a Kubernetes Pod, built from the events
+// the PodWatcher observes on the cluster.
+type Pod struct {
+	Name                string
+	PodTemplateSpecHash string
+	Namespace           string
+	AncestorUID         string
+	CreatedAt           metav1.Time
+
+	Phase         string
+	Status        string
+	StatusMessage string
+	Deleted       bool
+
+	Conditions     []PodCondition
+	Containers     []Container
+	InitContainers []Container
+
+	// DisruptionReason is copied verbatim from the pod's DisruptionTarget
+	// condition (e.g. PreemptionByKubeScheduler, DeletionByTaintManager,
+	// EvictionByEvictionAPI, DeletionByPodGC), when Kubernetes has reported
+	// one. It's left empty if the pod has never carried that condition.
+	//
+	// Once set, it's preserved across later updates even if a subsequent
+	// apiserver update drops the condition, so the UI can still explain why
+	// the pod died after the object itself disappears.
+	DisruptionReason string
+
+	// DisruptionMessage is the human-readable message that accompanied
+	// DisruptionReason.
+	DisruptionMessage string
+}
+
+// PodCondition mirrors the subset of corev1.PodCondition that Tilt cares
+// about.
+type PodCondition struct {
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+// Container is Tilt's read-only model of a container within a Pod.
+type Container struct {
+	Name     string
+	ID       string
+	Image    string
+	Ready    bool
+	Restarts int32
+	State    string
+}